@@ -0,0 +1,75 @@
+// Package dmarctest provides a hermetic lookup.Resolver for tests that
+// exercise DMARC lookups without making real DNS queries.
+package dmarctest
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/ncsham/go-openDMARC/lookup"
+)
+
+// MockResolver is a lookup.Resolver backed by static records, modeled
+// after the resolver used by mox's dmarc test suite.
+type MockResolver struct {
+	// TXT maps a fully-qualified name (e.g. "_dmarc.example.com") to the
+	// TXT records it should return.
+	TXT map[string][]string
+
+	// A and AAAA map a fully-qualified name to the addresses it should
+	// resolve to.
+	A    map[string][]net.IP
+	AAAA map[string][]net.IP
+
+	// MX maps a fully-qualified name to the hostnames of its MX records.
+	MX map[string][]string
+
+	// TempFail lists names whose lookup should simulate a temporary
+	// resolver failure (SERVFAIL/timeout) instead of NXDOMAIN.
+	TempFail map[string]bool
+}
+
+func (m MockResolver) LookupTXT(ctx context.Context, name string) ([]string, lookup.ResolveResult, error) {
+	if m.TempFail[name] {
+		return nil, lookup.ResolveTempFail, fmt.Errorf("dmarctest: simulated temporary failure for %s", name)
+	}
+	txts, ok := m.TXT[name]
+	if !ok {
+		return nil, lookup.ResolveNXDomain, fmt.Errorf("dmarctest: no such host: %s", name)
+	}
+	return txts, lookup.ResolveOK, nil
+}
+
+func (m MockResolver) LookupA(ctx context.Context, name string) ([]net.IP, lookup.ResolveResult, error) {
+	if m.TempFail[name] {
+		return nil, lookup.ResolveTempFail, fmt.Errorf("dmarctest: simulated temporary failure for %s", name)
+	}
+	addrs, ok := m.A[name]
+	if !ok {
+		return nil, lookup.ResolveNXDomain, fmt.Errorf("dmarctest: no such host: %s", name)
+	}
+	return addrs, lookup.ResolveOK, nil
+}
+
+func (m MockResolver) LookupAAAA(ctx context.Context, name string) ([]net.IP, lookup.ResolveResult, error) {
+	if m.TempFail[name] {
+		return nil, lookup.ResolveTempFail, fmt.Errorf("dmarctest: simulated temporary failure for %s", name)
+	}
+	addrs, ok := m.AAAA[name]
+	if !ok {
+		return nil, lookup.ResolveNXDomain, fmt.Errorf("dmarctest: no such host: %s", name)
+	}
+	return addrs, lookup.ResolveOK, nil
+}
+
+func (m MockResolver) LookupMX(ctx context.Context, name string) ([]string, lookup.ResolveResult, error) {
+	if m.TempFail[name] {
+		return nil, lookup.ResolveTempFail, fmt.Errorf("dmarctest: simulated temporary failure for %s", name)
+	}
+	hosts, ok := m.MX[name]
+	if !ok {
+		return nil, lookup.ResolveNXDomain, fmt.Errorf("dmarctest: no such host: %s", name)
+	}
+	return hosts, lookup.ResolveOK, nil
+}
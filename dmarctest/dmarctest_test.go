@@ -0,0 +1,30 @@
+package dmarctest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ncsham/go-openDMARC/lookup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockResolver(t *testing.T) {
+	resolver := MockResolver{
+		TXT: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject"},
+		},
+		TempFail: map[string]bool{
+			"_dmarc.flaky.com": true,
+		},
+	}
+
+	record, err := lookup.LookupCtx(context.Background(), "example.com", resolver)
+	require.NoError(t, err)
+	require.Equal(t, lookup.Policy(lookup.PolicyReject), record.Policy)
+
+	_, err = lookup.LookupCtx(context.Background(), "nonexistent.com", resolver)
+	require.ErrorIs(t, err, lookup.ErrNoPolicy)
+
+	_, err = lookup.LookupCtx(context.Background(), "flaky.com", resolver)
+	require.True(t, lookup.IsTempFail(err))
+}
@@ -2,77 +2,176 @@ package etldplusone
 
 import (
 	"bufio"
+	_ "embed"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
-const publicSuffixListURL = "https://publicsuffix.org/list/public_suffix_list.dat"
+//go:embed public_suffix_list.dat
+var embeddedList string
 
-// FetchPublicSuffixList fetches the Public Suffix List from the provided URL.
-func FetchPublicSuffixList(url string) ([]string, []string, []string, error) {
+// Section identifies which part of the Public Suffix List a rule came
+// from, per the "===BEGIN ICANN DOMAINS===" / "===BEGIN PRIVATE
+// DOMAINS===" markers in the upstream file.
+type Section int
+
+const (
+	SectionICANN Section = iota
+	SectionPrivate
+)
+
+// List is a compiled Public Suffix List. Rules are indexed by their own
+// text rather than kept in the upstream file's flat ordering, so
+// FindETLDPlusOne costs O(labels in the queried domain) instead of
+// O(rules x labels).
+type List struct {
+	mu         sync.RWMutex
+	exact      map[string]Section
+	wildcards  map[string]Section
+	exceptions map[string]Section
+}
+
+var (
+	defaultOnce sync.Once
+	defaultList *List
+	defaultErr  error
+)
+
+// DefaultList returns the Public Suffix List snapshot embedded in this
+// package, parsed once regardless of how many callers request it.
+func DefaultList() (*List, error) {
+	defaultOnce.Do(func() {
+		defaultList, defaultErr = parseList(strings.NewReader(embeddedList))
+	})
+	return defaultList, defaultErr
+}
+
+// FetchPublicSuffixList fetches a fresh copy of the Public Suffix List
+// from url and atomically swaps its rules into list, so a long-lived
+// List (such as the one returned by DefaultList) can be refreshed in
+// place without invalidating concurrent lookups.
+func FetchPublicSuffixList(url string, list *List) error {
 	resp, err := http.Get(url)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	var suffixes, wildcards, exceptions []string
-	scanner := bufio.NewScanner(resp.Body)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
+	fresh, err := parseList(resp.Body)
+	if err != nil {
+		return err
+	}
 
-		if len(line) == 0 || strings.HasPrefix(line, "//") {
-			continue // Skip comments and empty lines
+	list.mu.Lock()
+	list.exact, list.wildcards, list.exceptions = fresh.exact, fresh.wildcards, fresh.exceptions
+	list.mu.Unlock()
+	return nil
+}
+
+func parseList(r io.Reader) (*List, error) {
+	list := &List{
+		exact:      make(map[string]Section),
+		wildcards:  make(map[string]Section),
+		exceptions: make(map[string]Section),
+	}
+
+	section := SectionICANN
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "//") {
+			switch {
+			case strings.Contains(line, "===BEGIN ICANN DOMAINS==="):
+				section = SectionICANN
+			case strings.Contains(line, "===BEGIN PRIVATE DOMAINS==="):
+				section = SectionPrivate
+			}
+			continue // Skip comments and section markers
 		}
 
-		if strings.HasPrefix(line, "*.") {
-			wildcards = append(wildcards, line[2:]) // Remove "*."
-		} else if strings.HasPrefix(line, "!") {
-			exceptions = append(exceptions, line[1:]) // Remove "!"
-		} else {
-			suffixes = append(suffixes, line)
+		switch {
+		case strings.HasPrefix(line, "*."):
+			list.wildcards[strings.ToLower(line[2:])] = section
+		case strings.HasPrefix(line, "!"):
+			list.exceptions[strings.ToLower(line[1:])] = section
+		default:
+			list.exact[strings.ToLower(line)] = section
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	return suffixes, wildcards, exceptions, nil
+	return list, nil
 }
 
-// FindETLDPlusOne determines the eTLD+1 for a given domain using the suffix list.
-func FindETLDPlusOne(domain string, suffixes, wildcards, exceptions []string) (string, error) {
-	domainParts := strings.Split(domain, ".")
-	for i := 0; i < len(domainParts); i++ {
-		candidate := strings.Join(domainParts[i:], ".")
-
-		// Check exact matches
-		for _, suffix := range suffixes {
-			if strings.EqualFold(candidate, suffix) {
-				if i == 0 {
-					return domain, nil
-				}
-				return strings.Join(domainParts[i-1:], "."), nil
-			}
+// FindETLDPlusOneOpts customizes FindETLDPlusOne's matching behavior.
+type FindETLDPlusOneOpts struct {
+	// ICANNOnly restricts matching to the ICANN section of list,
+	// ignoring privately contributed suffixes such as "github.io". RFC
+	// 7489 section 3.2 requires this for DMARC alignment.
+	ICANNOnly bool
+}
+
+// FindETLDPlusOne determines the eTLD+1 (organizational/registrable
+// domain) for domain using list.
+func FindETLDPlusOne(domain string, list *List, opts FindETLDPlusOneOpts) (string, error) {
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	origLabels := strings.Split(domain, ".")
+	labels := make([]string, len(origLabels))
+	for i, l := range origLabels {
+		labels[i] = strings.ToLower(l)
+	}
+	n := len(labels)
+
+	allowed := func(section Section) bool {
+		return !opts.ICANNOnly || section == SectionICANN
+	}
+
+	for i := 0; i < n; i++ {
+		candidate := strings.Join(labels[i:], ".")
+
+		// An exception rule (e.g. "!www.ck") carves its own full match
+		// out of an enclosing wildcard rule, so the suffix ends one
+		// label earlier than the candidate itself.
+		if section, ok := list.exceptions[candidate]; ok && allowed(section) {
+			return trailingLabels(origLabels, n-i), nil
 		}
 
-		// Check wildcard matches
-		for _, wildcard := range wildcards {
-			if strings.HasSuffix(candidate, wildcard) {
-				// Check if there is any exception that matches this candidate
-				for _, exception := range exceptions {
-					if strings.Contains(strings.Join(domainParts[i:], "."), exception) {
-						return exception, nil
-					}
-				}
-				if i == 0 {
-					return domain, nil
-				}
-				return strings.Join(domainParts[i-1:], "."), nil
-			}
+		if section, ok := list.exact[candidate]; ok && allowed(section) {
+			return trailingLabels(origLabels, n-i+1), nil
 		}
 
+		// A wildcard rule (e.g. "*.ck") matches one arbitrary label
+		// plus its base, so check the base against the label that
+		// would sit just inside the current candidate.
+		if i+1 < n {
+			base := strings.Join(labels[i+1:], ".")
+			if section, ok := list.wildcards[base]; ok && allowed(section) {
+				return trailingLabels(origLabels, n-i+1), nil
+			}
+		}
 	}
+
 	return "", fmt.Errorf("no eTLD+1 found for domain: %s", domain)
-}
\ No newline at end of file
+}
+
+// trailingLabels joins the last count labels of labels, clamped to the
+// number of labels actually available.
+func trailingLabels(labels []string, count int) string {
+	n := len(labels)
+	if count > n {
+		count = n
+	}
+	if count < 1 {
+		count = 1
+	}
+	return strings.Join(labels[n-count:], ".")
+}
@@ -1,41 +1,57 @@
 package etldplusone
 
 import (
-	"github.com/stretchr/testify/require"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 // TestFindETLDPlusOne tests the FindETLDPlusOne function with various cases.
 func TestFindETLDPlusOne(t *testing.T) {
-	suffixes, wildcards, exceptions, err := FetchPublicSuffixList(publicSuffixListURL)
-	require.NoError(t, err, "Error fetching public suffix list")
+	list, err := DefaultList()
+	require.NoError(t, err, "Error loading default public suffix list")
 
 	testCases := []struct {
 		domain       string
+		opts         FindETLDPlusOneOpts
 		expectedETLD string
 		shouldError  bool
 	}{
-		{"a.nom.ad", "a.nom.ad", false},
-		{"a.gov.uk", "a.gov.uk", false},
-		{"a.b.gov.uk", "b.gov.uk", false},
-		{"sa.gov.au", "sa.gov.au", false},
-		{"gov.in", "gov.in", false},
-		{"app.stupid.email", "stupid.email", false},
-		{"stupid.email", "stupid.email", false},
-		{"a.b.c.stupid.email", "stupid.email", false},
-		{"a.stupid.email", "stupid.email", false},
-		{"a.v.gov.in", "v.gov.in", false},
-		{"OUTLOOK.COM.BR", "OUTLOOK.COM.BR", false},
-		{"App.stupid.Email", "stupid.Email", false},
-		{"a.hi.yokohama.jp", "a.hi.yokohama.jp", false},
-		{"a.city.yokohama.jp", "city.yokohama.jp", false},
-		{"a.com.pg", "a.com.pg", false},
-		{"a.com.kh", "a.com.kh", false},
+		{domain: "a.nom.ad", expectedETLD: "a.nom.ad"},
+		{domain: "a.gov.uk", expectedETLD: "a.gov.uk"},
+		{domain: "a.b.gov.uk", expectedETLD: "b.gov.uk"},
+		{domain: "sa.gov.au", expectedETLD: "sa.gov.au"},
+		{domain: "gov.in", expectedETLD: "gov.in"},
+		{domain: "app.stupid.email", expectedETLD: "stupid.email"},
+		{domain: "stupid.email", expectedETLD: "stupid.email"},
+		{domain: "a.b.c.stupid.email", expectedETLD: "stupid.email"},
+		{domain: "a.stupid.email", expectedETLD: "stupid.email"},
+		{domain: "a.v.gov.in", expectedETLD: "v.gov.in"},
+		{domain: "OUTLOOK.COM.BR", expectedETLD: "OUTLOOK.COM.BR"},
+		{domain: "App.stupid.Email", expectedETLD: "stupid.Email"},
+		{domain: "a.hi.yokohama.jp", expectedETLD: "a.hi.yokohama.jp"},
+		{domain: "a.city.yokohama.jp", expectedETLD: "city.yokohama.jp"},
+		{domain: "a.com.pg", expectedETLD: "a.com.pg"},
+		{domain: "a.com.kh", expectedETLD: "a.com.kh"},
+		// Wildcard + exception handling (RFC-style "*.ck" / "!www.ck").
+		{domain: "www.ck", expectedETLD: "www.ck"},
+		{domain: "foo.ck", expectedETLD: "foo.ck"},
+		{domain: "sub.foo.ck", expectedETLD: "sub.foo.ck"},
+		{domain: "deep.sub.foo.ck", expectedETLD: "sub.foo.ck"},
+		// ICANNOnly ignores privately contributed suffixes.
+		{domain: "foo.github.io", expectedETLD: "foo.github.io"},
+		{domain: "foo.github.io", opts: FindETLDPlusOneOpts{ICANNOnly: true}, expectedETLD: "github.io"},
+		// Common TLDs beyond the handful the other cases happen to touch.
+		{domain: "mail.example.de", expectedETLD: "example.de"},
+		{domain: "mail.example.fr", expectedETLD: "example.fr"},
+		{domain: "mail.example.it", expectedETLD: "example.it"},
+		{domain: "mail.example.ca", expectedETLD: "example.ca"},
+		{domain: "mail.example.co.jp", expectedETLD: "example.co.jp"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.domain, func(t *testing.T) {
-			eTLDPlusOne, err := FindETLDPlusOne(tc.domain, suffixes, wildcards, exceptions)
+			eTLDPlusOne, err := FindETLDPlusOne(tc.domain, list, tc.opts)
 			if tc.shouldError {
 				require.Error(t, err, "expected error for domain %s", tc.domain)
 			} else {
@@ -48,14 +64,14 @@ func TestFindETLDPlusOne(t *testing.T) {
 
 // BenchmarkFindETLDPlusOne benchmarks the FindETLDPlusOne function.
 func BenchmarkFindETLDPlusOne(b *testing.B) {
-	suffixes, wildcards, exceptions, err := FetchPublicSuffixList(publicSuffixListURL)
-	require.NoError(b, err, "Error fetching public suffix list")
+	list, err := DefaultList()
+	require.NoError(b, err, "Error loading default public suffix list")
 
 	domain := "a.com.kh"
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := FindETLDPlusOne(domain, suffixes, wildcards, exceptions)
+		_, err := FindETLDPlusOne(domain, list, FindETLDPlusOneOpts{})
 		require.NoError(b, err, "unexpected error for domain %s", domain)
 	}
 }
@@ -0,0 +1,237 @@
+// Package evaluate applies RFC 7489 section 6.6 to a single message: given
+// the RFC5322.From domain plus the SPF and DKIM authentication results for
+// that message, it resolves the applicable DMARC record, checks identifier
+// alignment, and returns the disposition the domain owner asked for.
+package evaluate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/ncsham/go-openDMARC/etldplusone"
+	"github.com/ncsham/go-openDMARC/lookup"
+)
+
+// Status mirrors the verdict a DMARC check can produce, modeled after
+// mox's dmarc package.
+type Status string
+
+const (
+	StatusNone      Status = "none"
+	StatusPass      Status = "pass"
+	StatusFail      Status = "fail"
+	StatusTempError Status = "temperror"
+	StatusPermError Status = "permerror"
+)
+
+// DKIMResult is the outcome of verifying a single DKIM signature on a
+// message, as needed to evaluate DKIM identifier alignment (RFC 7489
+// section 3.1.1).
+type DKIMResult struct {
+	Domain string // the signature's "d=" domain
+	Pass   bool
+}
+
+// SPFResult is the outcome of the SPF check for a message, as needed to
+// evaluate SPF identifier alignment (RFC 7489 section 3.1.2).
+type SPFResult struct {
+	Pass bool
+
+	// MailFrom is the domain from the MAIL FROM/Return-Path identity.
+	// HeloDomain is used instead when MailFrom is empty, per RFC 7489
+	// section 3.1.2.
+	MailFrom   string
+	HeloDomain string
+}
+
+// EvaluationInput carries everything Evaluate needs to apply RFC 7489
+// section 6.6 to a single message.
+type EvaluationInput struct {
+	// FromDomain is the domain of the RFC5322.From header.
+	FromDomain string
+	SPF        SPFResult
+	DKIM       []DKIMResult
+
+	// Resolver performs the DMARC record lookup. If nil, lookup.NetResolver
+	// is used.
+	Resolver lookup.Resolver
+}
+
+// Result is the outcome of evaluating a message against a domain's DMARC
+// policy.
+type Result struct {
+	Status Status
+
+	// Disposition is the policy action that applies to this message,
+	// after "pct" sampling has been applied.
+	Disposition lookup.Policy
+
+	// Domain is the domain whose DMARC record was applied. When the
+	// record lookup itself fails, it is FromDomain.
+	Domain string
+	// OrgDomain is the organizational domain derived from FromDomain.
+	OrgDomain string
+	Record    *lookup.Record
+
+	SPFAligned  bool
+	DKIMAligned bool
+
+	// AlignedIdentifiers lists the authenticated identifiers that
+	// produced an aligned pass, e.g. "dkim=example.com".
+	AlignedIdentifiers []string
+
+	// Reasons holds a short, per-mechanism explanation suitable for
+	// inclusion in an Authentication-Results header.
+	Reasons []string
+}
+
+// ErrNoFromDomain is returned when EvaluationInput has no RFC5322.From
+// domain to evaluate.
+var ErrNoFromDomain = errors.New("evaluate: missing RFC5322.From domain")
+
+// Evaluate applies RFC 7489 section 6.6 to in, returning the disposition
+// the domain owner published for it.
+func Evaluate(ctx context.Context, in EvaluationInput) (*Result, error) {
+	if in.FromDomain == "" {
+		return nil, ErrNoFromDomain
+	}
+
+	tree, err := lookup.LookupTreeCtx(ctx, in.FromDomain, in.Resolver)
+	if err != nil {
+		if errors.Is(err, lookup.ErrNoPolicy) {
+			return &Result{Status: StatusNone, Domain: in.FromDomain}, nil
+		}
+		if lookup.IsTempFail(err) {
+			return &Result{Status: StatusTempError, Domain: in.FromDomain}, err
+		}
+		return &Result{Status: StatusPermError, Domain: in.FromDomain}, err
+	}
+	record := tree.Record
+
+	res := &Result{Domain: tree.Domain, Record: record}
+
+	// orgErr tracks a failure to resolve an organizational domain, which
+	// must not be silently scored as "not aligned": once the PSL lookup
+	// itself is broken, every alignment check would spuriously fail. Leave
+	// OrgDomain unset rather than guessing, so it doesn't look resolved.
+	orgDomain, orgErr := organizationalDomain(in.FromDomain)
+	if orgErr == nil {
+		res.OrgDomain = orgDomain
+	}
+
+	for _, d := range in.DKIM {
+		if !d.Pass {
+			continue
+		}
+		ok, err := aligned(in.FromDomain, d.Domain, record.DKIMAlignment)
+		if err != nil {
+			orgErr = err
+			continue
+		}
+		if ok {
+			res.DKIMAligned = true
+			res.AlignedIdentifiers = append(res.AlignedIdentifiers, "dkim="+d.Domain)
+			res.Reasons = append(res.Reasons, fmt.Sprintf("dkim=pass header.d=%s", d.Domain))
+			break
+		}
+	}
+
+	spfDomain := in.SPF.MailFrom
+	if spfDomain == "" {
+		spfDomain = in.SPF.HeloDomain
+	}
+	if in.SPF.Pass && spfDomain != "" {
+		ok, err := aligned(in.FromDomain, spfDomain, record.SPFAlignment)
+		if err != nil {
+			orgErr = err
+		} else if ok {
+			res.SPFAligned = true
+			res.AlignedIdentifiers = append(res.AlignedIdentifiers, "spf="+spfDomain)
+			res.Reasons = append(res.Reasons, fmt.Sprintf("spf=pass smtp.mailfrom=%s", spfDomain))
+		}
+	}
+
+	if res.SPFAligned || res.DKIMAligned {
+		res.Status = StatusPass
+		res.Disposition = lookup.PolicyNone
+		return res, nil
+	}
+
+	if orgErr != nil {
+		// Alignment could not be determined at all: report the failure
+		// rather than guessing "not aligned" and applying a disposition
+		// the sender may not deserve.
+		res.Status = StatusPermError
+		return res, orgErr
+	}
+
+	res.Status = StatusFail
+	policy := record.Policy
+	if tree.TreeWalked && record.SubdomainPolicy != "" {
+		// The record was published at the organizational domain, so its
+		// "sp" (not "p") is what applies to in.FromDomain, per RFC 7489
+		// section 6.6.3.
+		policy = record.SubdomainPolicy
+	}
+	res.Disposition = applyPercent(record.Percent, policy)
+	res.Reasons = append(res.Reasons, fmt.Sprintf("dmarc=fail (p=%s sp=%s) header.from=%s", record.Policy, record.SubdomainPolicy, in.FromDomain))
+
+	return res, nil
+}
+
+// aligned reports whether authDomain is aligned with fromDomain under mode,
+// per RFC 7489 section 3.1: strict alignment requires an exact FQDN match,
+// relaxed alignment only requires a shared organizational domain. A non-nil
+// error means alignment could not be determined at all (e.g. the PSL lookup
+// failed) and must not be read as "not aligned".
+func aligned(fromDomain, authDomain string, mode lookup.AlignmentMode) (bool, error) {
+	if strings.EqualFold(fromDomain, authDomain) {
+		return true, nil
+	}
+	if mode == lookup.AlignmentStrict {
+		return false, nil
+	}
+
+	fromOrg, err := organizationalDomain(fromDomain)
+	if err != nil {
+		return false, err
+	}
+	authOrg, err := organizationalDomain(authDomain)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(fromOrg, authOrg), nil
+}
+
+func organizationalDomain(domain string) (string, error) {
+	list, err := etldplusone.DefaultList()
+	if err != nil {
+		return "", err
+	}
+	// RFC 7489 section 3.2 requires alignment's organizational domain
+	// to be derived from the ICANN section only.
+	return etldplusone.FindETLDPlusOne(domain, list, etldplusone.FindETLDPlusOneOpts{ICANNOnly: true})
+}
+
+// applyPercent implements the "pct" sampling described in RFC 7489 section
+// 6.6.4: when pct is below 100 and the pseudo-random selection lands outside
+// the applied bucket, the policy is downgraded one step.
+func applyPercent(pct *int, policy lookup.Policy) lookup.Policy {
+	if pct == nil || *pct >= 100 {
+		return policy
+	}
+	if rand.Intn(100) < *pct {
+		return policy
+	}
+	switch policy {
+	case lookup.PolicyReject:
+		return lookup.PolicyQuarantine
+	case lookup.PolicyQuarantine:
+		return lookup.PolicyNone
+	default:
+		return policy
+	}
+}
@@ -0,0 +1,106 @@
+package evaluate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ncsham/go-openDMARC/dmarctest"
+	"github.com/ncsham/go-openDMARC/lookup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateNoPolicy(t *testing.T) {
+	resolver := dmarctest.MockResolver{}
+	got, err := Evaluate(context.Background(), EvaluationInput{
+		FromDomain: "example.com",
+		DKIM:       []DKIMResult{{Domain: "example.com", Pass: true}},
+		Resolver:   resolver,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusNone, got.Status)
+}
+
+func TestEvaluatePass(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject"},
+		},
+	}
+	got, err := Evaluate(context.Background(), EvaluationInput{
+		FromDomain: "example.com",
+		DKIM:       []DKIMResult{{Domain: "example.com", Pass: true}},
+		Resolver:   resolver,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusPass, got.Status)
+	require.True(t, got.DKIMAligned)
+	require.Equal(t, lookup.PolicyNone, got.Disposition)
+}
+
+func TestEvaluateSubdomainFallsBackToOrgSubdomainPolicy(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject; sp=quarantine"},
+		},
+	}
+	got, err := Evaluate(context.Background(), EvaluationInput{
+		FromDomain: "sub.example.com",
+		Resolver:   resolver,
+	})
+	require.NoError(t, err)
+	require.Equal(t, StatusFail, got.Status)
+	require.Equal(t, lookup.Policy(lookup.PolicyQuarantine), got.Disposition)
+}
+
+func TestAligned(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fromDomain string
+		authDomain string
+		mode       lookup.AlignmentMode
+		want       bool
+	}{
+		{"exact match strict", "mail.example.com", "mail.example.com", lookup.AlignmentStrict, true},
+		{"subdomain strict fails", "mail.example.com", "example.com", lookup.AlignmentStrict, false},
+		{"subdomain relaxed passes", "mail.example.com", "example.com", lookup.AlignmentRelaxed, true},
+		{"unrelated domain relaxed fails", "example.com", "example.org", lookup.AlignmentRelaxed, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := aligned(tc.fromDomain, tc.authDomain, tc.mode)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAlignedUnresolvableOrgDomainErrors(t *testing.T) {
+	_, err := aligned("mail.example.invalidtld", "example.invalidtld", lookup.AlignmentRelaxed)
+	require.Error(t, err)
+}
+
+func TestEvaluateUnresolvableOrgDomainIsPermError(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT: map[string][]string{
+			"_dmarc.mail.example.invalidtld": {"v=DMARC1; p=reject"},
+		},
+	}
+	got, err := Evaluate(context.Background(), EvaluationInput{
+		FromDomain: "mail.example.invalidtld",
+		DKIM:       []DKIMResult{{Domain: "example.invalidtld", Pass: true}},
+		Resolver:   resolver,
+	})
+	require.Error(t, err)
+	require.Equal(t, StatusPermError, got.Status)
+}
+
+func TestApplyPercent(t *testing.T) {
+	full := 100
+	require.Equal(t, lookup.Policy(lookup.PolicyReject), applyPercent(&full, lookup.PolicyReject))
+	require.Equal(t, lookup.Policy(lookup.PolicyReject), applyPercent(nil, lookup.PolicyReject))
+
+	zero := 0
+	require.Equal(t, lookup.Policy(lookup.PolicyQuarantine), applyPercent(&zero, lookup.PolicyReject))
+	require.Equal(t, lookup.Policy(lookup.PolicyNone), applyPercent(&zero, lookup.PolicyQuarantine))
+	require.Equal(t, lookup.Policy(lookup.PolicyNone), applyPercent(&zero, lookup.PolicyNone))
+}
@@ -3,12 +3,15 @@
 package lookup
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ncsham/go-openDMARC/etldplusone"
 )
 
 type AlignmentMode string
@@ -38,7 +41,7 @@ const (
 type ReportFormat string
 
 const (
-	ReportFormatAFRF ReportFormat = "afrf"
+	ReportFormatAFRF  ReportFormat = "afrf"
 	ReportFormatIODEF ReportFormat = "iodef"
 )
 
@@ -62,17 +65,17 @@ const (
 )
 
 var RFCSupportedTags = map[string]struct{}{
-    "v":     {},
-    "p":     {},
-    "adkim": {},
-    "aspf":  {},
-    "fo":    {},
-    "pct":   {},
-    "rf":    {},
-    "ri":    {},
-    "rua":   {},
-    "ruf":   {},
-    "sp":    {},
+	"v":     {},
+	"p":     {},
+	"adkim": {},
+	"aspf":  {},
+	"fo":    {},
+	"pct":   {},
+	"rf":    {},
+	"ri":    {},
+	"rua":   {},
+	"ruf":   {},
+	"sp":    {},
 }
 
 type tempFailError string
@@ -97,26 +100,228 @@ type LookupOptions struct {
 	LookupTXT func(domain string) ([]string, error)
 }
 
+// ResolveResult classifies the outcome of a Resolver's LookupTXT call.
+type ResolveResult int
+
+const (
+	ResolveOK ResolveResult = iota
+	ResolveNXDomain
+	ResolveTempFail
+)
+
+// Resolver performs the DNS lookups DMARC and SPF evaluation need,
+// distinguishing NXDOMAIN from SERVFAIL/timeout so callers can tell a
+// name with no records apart from a resolver that is currently
+// unreachable. LookupA, LookupAAAA and LookupMX exist for the spf
+// package's "a"/"mx" mechanisms; LookupCtx itself only uses LookupTXT.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, ResolveResult, error)
+	LookupA(ctx context.Context, name string) ([]net.IP, ResolveResult, error)
+	LookupAAAA(ctx context.Context, name string) ([]net.IP, ResolveResult, error)
+	LookupMX(ctx context.Context, name string) ([]string, ResolveResult, error)
+}
+
+// NetResolver is the default Resolver, backed by net.DefaultResolver with
+// a bounded timeout per lookup.
+type NetResolver struct {
+	// Timeout bounds each lookup call. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+func (r NetResolver) timeoutCtx(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (r NetResolver) LookupTXT(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	ctx, cancel := r.timeoutCtx(ctx)
+	defer cancel()
+
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ResolveNXDomain, err
+		}
+		return nil, ResolveTempFail, err
+	}
+	return txts, ResolveOK, nil
+}
+
+func (r NetResolver) lookupIP(ctx context.Context, network, name string) ([]net.IP, ResolveResult, error) {
+	ctx, cancel := r.timeoutCtx(ctx)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIP(ctx, network, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ResolveNXDomain, err
+		}
+		return nil, ResolveTempFail, err
+	}
+	return addrs, ResolveOK, nil
+}
+
+func (r NetResolver) LookupA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return r.lookupIP(ctx, "ip4", name)
+}
+
+func (r NetResolver) LookupAAAA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return r.lookupIP(ctx, "ip6", name)
+}
+
+func (r NetResolver) LookupMX(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	ctx, cancel := r.timeoutCtx(ctx)
+	defer cancel()
+
+	records, err := net.DefaultResolver.LookupMX(ctx, name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ResolveNXDomain, err
+		}
+		return nil, ResolveTempFail, err
+	}
+	hosts := make([]string, len(records))
+	for i, mx := range records {
+		hosts[i] = strings.TrimSuffix(mx.Host, ".")
+	}
+	return hosts, ResolveOK, nil
+}
+
+// legacyResolver adapts the pre-Resolver LookupOptions.LookupTXT callback
+// to the Resolver interface. It only ever serves TXT lookups, since that
+// callback is the sole thing LookupOptions ever exposed.
+type legacyResolver struct {
+	lookupTXT func(domain string) ([]string, error)
+}
+
+func (r legacyResolver) LookupTXT(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	txts, err := r.lookupTXT(name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, ResolveNXDomain, err
+		}
+		return nil, ResolveTempFail, err
+	}
+	return txts, ResolveOK, nil
+}
+
+var errLegacyUnsupported = errors.New("lookup: A/AAAA/MX lookups are not available via the legacy LookupOptions.LookupTXT callback")
+
+func (r legacyResolver) LookupA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return nil, ResolveTempFail, errLegacyUnsupported
+}
+
+func (r legacyResolver) LookupAAAA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return nil, ResolveTempFail, errLegacyUnsupported
+}
+
+func (r legacyResolver) LookupMX(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	return nil, ResolveTempFail, errLegacyUnsupported
+}
+
+// TreeResult is the outcome of resolving a domain's DMARC policy via
+// LookupTree, including where the record that applies to domain was
+// actually published.
+type TreeResult struct {
+	Record *Record
+
+	// Domain is the domain the applied record was published at. It
+	// differs from the domain originally queried when TreeWalked is true.
+	Domain string
+
+	// TreeWalked reports whether the record was found by retrying at the
+	// organizational domain per RFC 7489 section 6.6.3, rather than at
+	// the domain originally queried.
+	TreeWalked bool
+}
+
 // Lookup queries a DMARC record for a specified domain.
 func Lookup(domain string) (*Record, error) {
 	return LookupWithOptions(domain, nil)
 }
 
 func LookupWithOptions(domain string, options *LookupOptions) (*Record, error) {
-	var txts []string
-	var dmarcRecords []Record
-	var err error
-	if options != nil && options.LookupTXT != nil {
-		txts, err = options.LookupTXT("_dmarc." + domain)
-	} else {
-		txts, err = net.LookupTXT("_dmarc." + domain)
+	return lookupRecord(domain, options)
+}
+
+// LookupCtx queries a DMARC record for domain using resolver. If resolver
+// is nil, NetResolver is used.
+func LookupCtx(ctx context.Context, domain string, resolver Resolver) (*Record, error) {
+	if resolver == nil {
+		resolver = NetResolver{}
+	}
+	return recordFromResolver(ctx, domain, resolver)
+}
+
+// LookupTree resolves domain's DMARC policy per RFC 7489 section 6.6.3,
+// using the legacy LookupOptions.LookupTXT callback if options is non-nil.
+func LookupTree(domain string, options *LookupOptions) (*TreeResult, error) {
+	return LookupTreeCtx(context.Background(), domain, resolverFromOptions(options))
+}
+
+// LookupTreeCtx resolves domain's DMARC policy via resolver per RFC 7489
+// section 6.6.3: if "_dmarc.<domain>" publishes no policy, it retries at
+// the organizational domain. The Record returned is always exactly as
+// published; callers that need the effective policy for domain must
+// apply "sp" themselves when TreeWalked is true, per section 6.6.3. If
+// resolver is nil, NetResolver is used.
+func LookupTreeCtx(ctx context.Context, domain string, resolver Resolver) (*TreeResult, error) {
+	if resolver == nil {
+		resolver = NetResolver{}
+	}
+
+	record, err := recordFromResolver(ctx, domain, resolver)
+	if err == nil {
+		return &TreeResult{Record: record, Domain: domain}, nil
+	}
+	if err != ErrNoPolicy {
+		// Temp-fail (and other) errors on the subdomain query
+		// short-circuit rather than walking upward.
+		return nil, err
+	}
+
+	orgDomain, orgErr := organizationalDomain(domain)
+	if orgErr != nil {
+		return nil, ErrNoPolicy
+	}
+	if strings.EqualFold(orgDomain, domain) {
+		return nil, ErrNoPolicy
 	}
 
+	orgRecord, err := recordFromResolver(ctx, orgDomain, resolver)
 	if err != nil {
-		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
-			return nil, ErrNoPolicy
-		}
-		return nil, errors.New("dmarc: failed to lookup TXT record: " + err.Error())
+		return nil, err
+	}
+
+	return &TreeResult{Record: orgRecord, Domain: orgDomain, TreeWalked: true}, nil
+}
+
+func lookupRecord(domain string, options *LookupOptions) (*Record, error) {
+	return recordFromResolver(context.Background(), domain, resolverFromOptions(options))
+}
+
+// resolverFromOptions adapts the legacy *LookupOptions into a Resolver,
+// falling back to NetResolver when options or its LookupTXT callback is
+// unset.
+func resolverFromOptions(options *LookupOptions) Resolver {
+	if options != nil && options.LookupTXT != nil {
+		return legacyResolver{lookupTXT: options.LookupTXT}
+	}
+	return NetResolver{}
+}
+
+func recordFromResolver(ctx context.Context, domain string, resolver Resolver) (*Record, error) {
+	var dmarcRecords []Record
+
+	txts, result, err := resolver.LookupTXT(ctx, "_dmarc."+domain)
+	switch result {
+	case ResolveNXDomain:
+		return nil, ErrNoPolicy
+	case ResolveTempFail:
+		return nil, tempFailError(err.Error())
 	}
 
 	if len(txts) == 0 {
@@ -328,10 +533,20 @@ func parseURIList(s string) []string {
 	return l
 }
 
+func organizationalDomain(domain string) (string, error) {
+	list, err := etldplusone.DefaultList()
+	if err != nil {
+		return "", err
+	}
+	// RFC 7489 section 3.2 requires the organizational domain used for
+	// the tree walk to be derived from the ICANN section only.
+	return etldplusone.FindETLDPlusOne(domain, list, etldplusone.FindETLDPlusOneOpts{ICANNOnly: true})
+}
+
 func toLowerCaseSlice(arr []string) []string {
-    lowerCaseArr := make([]string, len(arr))
-    for i, v := range arr {
-        lowerCaseArr[i] = strings.ToLower(v)
-    }
-    return lowerCaseArr
+	lowerCaseArr := make([]string, len(arr))
+	for i, v := range arr {
+		lowerCaseArr[i] = strings.ToLower(v)
+	}
+	return lowerCaseArr
 }
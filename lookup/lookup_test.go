@@ -3,27 +3,164 @@
 package lookup
 
 import (
-	"github.com/stretchr/testify/require"
+	"context"
+	"errors"
+	"net"
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
+type mockResolver struct {
+	txt      map[string][]string
+	tempFail map[string]bool
+}
+
+func (m mockResolver) LookupTXT(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	if m.tempFail[name] {
+		return nil, ResolveTempFail, errors.New("simulated temporary failure")
+	}
+	txts, ok := m.txt[name]
+	if !ok {
+		return nil, ResolveNXDomain, errors.New("no such host")
+	}
+	return txts, ResolveOK, nil
+}
+
+func (m mockResolver) LookupA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return nil, ResolveNXDomain, errors.New("no such host")
+}
+
+func (m mockResolver) LookupAAAA(ctx context.Context, name string) ([]net.IP, ResolveResult, error) {
+	return nil, ResolveNXDomain, errors.New("no such host")
+}
+
+func (m mockResolver) LookupMX(ctx context.Context, name string) ([]string, ResolveResult, error) {
+	return nil, ResolveNXDomain, errors.New("no such host")
+}
+
+func TestLookupCtx(t *testing.T) {
+	resolver := mockResolver{
+		txt: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject"},
+		},
+		tempFail: map[string]bool{
+			"_dmarc.flaky.com": true,
+		},
+	}
+
+	record, err := LookupCtx(context.Background(), "example.com", resolver)
+	require.NoError(t, err)
+	require.Equal(t, Policy(PolicyReject), record.Policy)
+
+	_, err = LookupCtx(context.Background(), "nonexistent.com", resolver)
+	require.ErrorIs(t, err, ErrNoPolicy)
+
+	_, err = LookupCtx(context.Background(), "flaky.com", resolver)
+	require.True(t, IsTempFail(err))
+}
+
+func TestLookupTreeCtx(t *testing.T) {
+	testCases := []struct {
+		name             string
+		domain           string
+		resolver         mockResolver
+		wantErr          bool
+		treeWalked       bool
+		wantPolicy       Policy
+		wantSubdomainPol Policy
+	}{
+		{
+			name:    "no policy anywhere in the tree",
+			domain:  "sub.nopolicy.com",
+			wantErr: true,
+		},
+		{
+			name:   "subdomain publishes its own record",
+			domain: "mail.example.com",
+			resolver: mockResolver{
+				txt: map[string][]string{
+					"_dmarc.mail.example.com": {"v=DMARC1; p=quarantine"},
+				},
+			},
+			wantPolicy: PolicyQuarantine,
+		},
+		{
+			name:   "subdomain has no record, org domain record is returned as published",
+			domain: "sub.example.com",
+			resolver: mockResolver{
+				txt: map[string][]string{
+					"_dmarc.example.com": {"v=DMARC1; p=reject; sp=quarantine"},
+				},
+			},
+			treeWalked:       true,
+			wantPolicy:       PolicyReject,
+			wantSubdomainPol: PolicyQuarantine,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LookupTreeCtx(context.Background(), tc.domain, tc.resolver)
+			if tc.wantErr {
+				require.Error(t, err, "expected error for domain %s", tc.domain)
+				return
+			}
+			require.NoError(t, err, "unexpected error for domain %s", tc.domain)
+			require.Equal(t, tc.treeWalked, got.TreeWalked, "unexpected TreeWalked for domain %s", tc.domain)
+			require.Equal(t, tc.wantPolicy, got.Record.Policy, "unexpected published policy for domain %s", tc.domain)
+			require.Equal(t, tc.wantSubdomainPol, got.Record.SubdomainPolicy, "unexpected published subdomain policy for domain %s", tc.domain)
+		})
+	}
+}
+
+func TestLookupTreeCtxTempFailShortCircuits(t *testing.T) {
+	resolver := mockResolver{
+		txt: map[string][]string{
+			// Present so that a tree walk up to the org domain would
+			// otherwise succeed, proving the short-circuit below is what
+			// actually stops it, not a missing org record.
+			"_dmarc.example.com": {"v=DMARC1; p=reject"},
+		},
+		tempFail: map[string]bool{
+			"_dmarc.sub.example.com": true,
+		},
+	}
+
+	_, err := LookupTreeCtx(context.Background(), "sub.example.com", resolver)
+	require.True(t, IsTempFail(err), "expected a temp-fail error, got %v", err)
+}
+
 func TestLookupWithOptions(t *testing.T) {
+	resolver := mockResolver{
+		txt: map[string][]string{
+			"_dmarc.example.com": {"v=DMARC1; p=reject"},
+		},
+	}
+	lookupTXT := func(domain string) ([]string, error) {
+		txts, _, err := resolver.LookupTXT(context.Background(), domain)
+		return txts, err
+	}
+
 	testCases := []struct {
-		name    string
-		domain  string
-		want    *Record
+		name        string
+		domain      string
+		want        *Record
 		shouldError bool
 	}{
 		{
-			name:   "non-existent dmarc record",
-			domain: "ncsham.in",
-			want: nil,
+			name:        "non-existent dmarc record",
+			domain:      "nonexistent.com",
 			shouldError: true,
 		},
+		{
+			name:   "existing dmarc record",
+			domain: "example.com",
+			want:   &Record{Policy: PolicyReject, DKIMAlignment: AlignmentRelaxed, SPFAlignment: AlignmentRelaxed},
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := LookupWithOptions(tc.domain, nil)
+			got, err := LookupWithOptions(tc.domain, &LookupOptions{LookupTXT: lookupTXT})
 			if tc.shouldError {
 				require.Error(t, err, "expected error for domain %s", tc.domain)
 			} else {
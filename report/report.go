@@ -0,0 +1,237 @@
+// Package report implements the DMARC aggregate (RUA) feedback XML
+// schema from RFC 7489 Appendix C, so operators can both generate and
+// consume aggregate reports.
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/ncsham/go-openDMARC/evaluate"
+	"github.com/ncsham/go-openDMARC/lookup"
+)
+
+// Feedback is the root element of a DMARC aggregate report.
+type Feedback struct {
+	XMLName         xml.Name        `xml:"feedback"`
+	ReportMetadata  ReportMetadata  `xml:"report_metadata"`
+	PolicyPublished PolicyPublished `xml:"policy_published"`
+	Records         []Record        `xml:"record"`
+}
+
+// DateRange is the reporting window, as Unix seconds.
+type DateRange struct {
+	Begin int64 `xml:"begin"`
+	End   int64 `xml:"end"`
+}
+
+// ReportMetadata identifies the reporter and the report itself.
+type ReportMetadata struct {
+	OrgName   string    `xml:"org_name"`
+	Email     string    `xml:"email"`
+	ReportID  string    `xml:"report_id"`
+	DateRange DateRange `xml:"date_range"`
+}
+
+// PolicyPublished mirrors the lookup.Record the report was evaluated
+// against.
+type PolicyPublished struct {
+	Domain          string `xml:"domain"`
+	ADKIM           string `xml:"adkim"`
+	ASPF            string `xml:"aspf"`
+	Policy          string `xml:"p"`
+	SubdomainPolicy string `xml:"sp"`
+	Percent         int    `xml:"pct"`
+}
+
+// PolicyEvaluated is the disposition a report sender actually applied to
+// a row of traffic, and whether DKIM/SPF produced an aligned pass.
+type PolicyEvaluated struct {
+	Disposition string `xml:"disposition"`
+	DKIM        string `xml:"dkim"`
+	SPF         string `xml:"spf"`
+}
+
+// Row is the per-source-IP traffic and disposition summary for a Record.
+type Row struct {
+	SourceIP        string          `xml:"source_ip"`
+	Count           int             `xml:"count"`
+	PolicyEvaluated PolicyEvaluated `xml:"policy_evaluated"`
+}
+
+// Identifiers carries the identifiers the DMARC check was performed
+// against.
+type Identifiers struct {
+	HeaderFrom   string `xml:"header_from"`
+	EnvelopeFrom string `xml:"envelope_from,omitempty"`
+}
+
+// DKIMAuthResult is one DKIM signature's verification outcome.
+type DKIMAuthResult struct {
+	Domain string `xml:"domain"`
+	Result string `xml:"result"`
+}
+
+// SPFAuthResult is the SPF check's outcome.
+type SPFAuthResult struct {
+	Domain string `xml:"domain"`
+	Result string `xml:"result"`
+}
+
+// AuthResults lists the underlying authentication mechanism results that
+// fed into PolicyEvaluated.
+type AuthResults struct {
+	DKIM []DKIMAuthResult `xml:"dkim,omitempty"`
+	SPF  []SPFAuthResult  `xml:"spf,omitempty"`
+}
+
+// Record is one aggregated row of a DMARC aggregate report.
+type Record struct {
+	Row         Row         `xml:"row"`
+	Identifiers Identifiers `xml:"identifiers"`
+	AuthResults AuthResults `xml:"auth_results"`
+}
+
+// Marshal writes f to w as schema-compliant DMARC aggregate report XML,
+// including the "<?xml?>" prolog.
+func Marshal(w io.Writer, f *Feedback) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(f)
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Parse reads a DMARC aggregate report from r, auto-detecting and
+// decompressing the gzip-wrapped form typical of RUA mail attachments.
+func Parse(r io.Reader) (*Feedback, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("report: gzip: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var f Feedback
+	if err := xml.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("report: parse: %w", err)
+	}
+	return &f, nil
+}
+
+// Builder aggregates per-source-IP evaluate.Result values, over a
+// reporting time window, into a Feedback ready for Marshal.
+type Builder struct {
+	Domain   string
+	OrgName  string
+	Email    string
+	ReportID string
+	Begin    int64
+	End      int64
+
+	counts map[aggregateKey]int
+	order  []aggregateKey
+}
+
+type aggregateKey struct {
+	sourceIP    string
+	headerFrom  string
+	disposition lookup.Policy
+	dkimAligned bool
+	spfAligned  bool
+}
+
+// NewBuilder returns a Builder for a report covering [begin, end] (Unix
+// seconds) on behalf of domain.
+func NewBuilder(domain, orgName, email, reportID string, begin, end int64) *Builder {
+	return &Builder{
+		Domain:   domain,
+		OrgName:  orgName,
+		Email:    email,
+		ReportID: reportID,
+		Begin:    begin,
+		End:      end,
+		counts:   make(map[aggregateKey]int),
+	}
+}
+
+// Add folds one message's evaluation result, received from sourceIP,
+// into the report being built.
+func (b *Builder) Add(sourceIP, headerFrom string, res *evaluate.Result) {
+	k := aggregateKey{
+		sourceIP:    sourceIP,
+		headerFrom:  headerFrom,
+		disposition: res.Disposition,
+		dkimAligned: res.DKIMAligned,
+		spfAligned:  res.SPFAligned,
+	}
+	if _, ok := b.counts[k]; !ok {
+		b.order = append(b.order, k)
+	}
+	b.counts[k]++
+}
+
+// Build produces the Feedback accumulated so far, publishing record as
+// the policy the report describes.
+func (b *Builder) Build(record *lookup.Record) *Feedback {
+	f := &Feedback{
+		ReportMetadata: ReportMetadata{
+			OrgName:   b.OrgName,
+			Email:     b.Email,
+			ReportID:  b.ReportID,
+			DateRange: DateRange{Begin: b.Begin, End: b.End},
+		},
+		PolicyPublished: policyPublished(b.Domain, record),
+	}
+
+	for _, k := range b.order {
+		f.Records = append(f.Records, Record{
+			Row: Row{
+				SourceIP: k.sourceIP,
+				Count:    b.counts[k],
+				PolicyEvaluated: PolicyEvaluated{
+					Disposition: string(k.disposition),
+					DKIM:        passFail(k.dkimAligned),
+					SPF:         passFail(k.spfAligned),
+				},
+			},
+			Identifiers: Identifiers{HeaderFrom: k.headerFrom},
+		})
+	}
+	return f
+}
+
+func passFail(aligned bool) string {
+	if aligned {
+		return "pass"
+	}
+	return "fail"
+}
+
+func policyPublished(domain string, record *lookup.Record) PolicyPublished {
+	pct := 100
+	if record.Percent != nil {
+		pct = *record.Percent
+	}
+	return PolicyPublished{
+		Domain:          domain,
+		ADKIM:           string(record.DKIMAlignment),
+		ASPF:            string(record.SPFAlignment),
+		Policy:          string(record.Policy),
+		SubdomainPolicy: string(record.SubdomainPolicy),
+		Percent:         pct,
+	}
+}
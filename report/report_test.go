@@ -0,0 +1,113 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/ncsham/go-openDMARC/evaluate"
+	"github.com/ncsham/go-openDMARC/lookup"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalParseRoundTrip(t *testing.T) {
+	f := &Feedback{
+		ReportMetadata: ReportMetadata{
+			OrgName:  "example.org",
+			Email:    "noreply@example.org",
+			ReportID: "1",
+			DateRange: DateRange{
+				Begin: 1000,
+				End:   2000,
+			},
+		},
+		PolicyPublished: PolicyPublished{
+			Domain:  "example.com",
+			ADKIM:   "r",
+			ASPF:    "r",
+			Policy:  "reject",
+			Percent: 100,
+		},
+		Records: []Record{
+			{
+				Row: Row{
+					SourceIP: "203.0.113.1",
+					Count:    2,
+					PolicyEvaluated: PolicyEvaluated{
+						Disposition: "none",
+						DKIM:        "pass",
+						SPF:         "fail",
+					},
+				},
+				Identifiers: Identifiers{HeaderFrom: "example.com"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Marshal(&buf, f))
+	require.Contains(t, buf.String(), "<?xml")
+
+	got, err := Parse(&buf)
+	require.NoError(t, err)
+	f.XMLName = got.XMLName
+	require.Equal(t, f, got)
+}
+
+func TestParseGzipped(t *testing.T) {
+	f := &Feedback{
+		ReportMetadata:  ReportMetadata{OrgName: "example.org"},
+		PolicyPublished: PolicyPublished{Domain: "example.com"},
+	}
+
+	var plain bytes.Buffer
+	require.NoError(t, Marshal(&plain, f))
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write(plain.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	got, err := Parse(&gz)
+	require.NoError(t, err)
+	f.XMLName = got.XMLName
+	require.Equal(t, f, got)
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder("example.com", "example.org", "noreply@example.org", "1", 1000, 2000)
+	b.Add("203.0.113.1", "example.com", &evaluate.Result{
+		Disposition: lookup.PolicyNone,
+		DKIMAligned: true,
+	})
+	b.Add("203.0.113.1", "example.com", &evaluate.Result{
+		Disposition: lookup.PolicyNone,
+		DKIMAligned: true,
+	})
+	b.Add("203.0.113.2", "example.com", &evaluate.Result{
+		Disposition: lookup.Policy(lookup.PolicyReject),
+	})
+
+	pct := 100
+	record := &lookup.Record{
+		DKIMAlignment: lookup.AlignmentRelaxed,
+		SPFAlignment:  lookup.AlignmentRelaxed,
+		Policy:        lookup.PolicyReject,
+		Percent:       &pct,
+	}
+
+	f := b.Build(record)
+	require.Equal(t, "example.com", f.PolicyPublished.Domain)
+	require.Equal(t, 100, f.PolicyPublished.Percent)
+	require.Len(t, f.Records, 2)
+
+	require.Equal(t, "203.0.113.1", f.Records[0].Row.SourceIP)
+	require.Equal(t, 2, f.Records[0].Row.Count)
+	require.Equal(t, "pass", f.Records[0].Row.PolicyEvaluated.DKIM)
+	require.Equal(t, "fail", f.Records[0].Row.PolicyEvaluated.SPF)
+
+	require.Equal(t, "203.0.113.2", f.Records[1].Row.SourceIP)
+	require.Equal(t, 1, f.Records[1].Row.Count)
+	require.Equal(t, "reject", f.Records[1].Row.PolicyEvaluated.Disposition)
+}
@@ -0,0 +1,424 @@
+// Package spf implements enough of RFC 7208 SPF evaluation to support
+// DMARC alignment checks: it parses a domain's "v=spf1" TXT record and
+// evaluates the "all", "include", "redirect=", "a", "mx", "ip4" and
+// "ip6" mechanisms/modifiers against a sending IP. "exists", "ptr",
+// "exp=" and any macro usage are not supported; encountering one of
+// these fails open to Neutral rather than guessing at a result.
+package spf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ncsham/go-openDMARC/lookup"
+)
+
+// Result mirrors the possible outcomes of an SPF check, per RFC 7208
+// section 2.6.
+type Result string
+
+const (
+	Pass      Result = "pass"
+	Fail      Result = "fail"
+	SoftFail  Result = "softfail"
+	Neutral   Result = "neutral"
+	None      Result = "none"
+	TempError Result = "temperror"
+	PermError Result = "permerror"
+)
+
+// Domain is the domain whose SPF policy produced a Check result: the
+// domain originally checked, or the target of its "redirect=" modifier
+// when one applied.
+type Domain string
+
+// ErrTooManyDNSLookups is returned, as PermError, when evaluating a
+// record would exceed the RFC 7208 section 4.6.4 limit of 10 DNS
+// lookups.
+var ErrTooManyDNSLookups = errors.New("spf: exceeded the 10 DNS-lookup limit")
+
+// ErrTooManyVoidLookups is returned, as PermError, when evaluating a
+// record would exceed the RFC 7208 section 4.6.4 limit of 2 lookups
+// that return neither an error nor any data.
+var ErrTooManyVoidLookups = errors.New("spf: exceeded the 2 void-lookup limit")
+
+// Check evaluates the SPF policy for the domain responsible for a
+// message, per RFC 7208 section 2.4: the MAIL FROM domain, falling back
+// to the HELO/EHLO domain when MAIL FROM is empty (as with a bounce).
+// If r is nil, lookup.NetResolver is used.
+func Check(ctx context.Context, ip net.IP, mailFrom, helo string, r lookup.Resolver) (Result, Domain, error) {
+	domain := domainOf(mailFrom)
+	if domain == "" {
+		domain = helo
+	}
+	if domain == "" {
+		return None, "", nil
+	}
+	if r == nil {
+		r = lookup.NetResolver{}
+	}
+
+	st := &state{ctx: ctx, resolver: r}
+	res, authDomain, err := st.checkHost(domain, ip, 0)
+	return res, Domain(authDomain), err
+}
+
+func domainOf(mailFrom string) string {
+	at := strings.LastIndexByte(mailFrom, '@')
+	if at < 0 {
+		return ""
+	}
+	return mailFrom[at+1:]
+}
+
+// state carries the counters RFC 7208 section 4.6.4 requires across the
+// recursive evaluation of includes and redirects.
+type state struct {
+	ctx      context.Context
+	resolver lookup.Resolver
+
+	dnsLookups  int
+	voidLookups int
+}
+
+func (s *state) countLookup() error {
+	s.dnsLookups++
+	if s.dnsLookups > 10 {
+		return ErrTooManyDNSLookups
+	}
+	return nil
+}
+
+func (s *state) countVoidIfEmpty(rr lookup.ResolveResult, n int) error {
+	if rr != lookup.ResolveNXDomain && n > 0 {
+		return nil
+	}
+	s.voidLookups++
+	if s.voidLookups > 2 {
+		return ErrTooManyVoidLookups
+	}
+	return nil
+}
+
+func isSPFRecord(txt string) bool {
+	return txt == "v=spf1" || strings.HasPrefix(txt, "v=spf1 ")
+}
+
+func containsMacro(s string) bool {
+	return strings.ContainsRune(s, '%')
+}
+
+func qualifierResult(q byte) Result {
+	switch q {
+	case '-':
+		return Fail
+	case '~':
+		return SoftFail
+	case '?':
+		return Neutral
+	default:
+		return Pass
+	}
+}
+
+// checkHost resolves and evaluates the SPF record published at domain,
+// returning the domain whose record actually produced the result (which
+// differs from domain when a "redirect=" modifier applied).
+func (s *state) checkHost(domain string, ip net.IP, depth int) (Result, string, error) {
+	if depth > 10 {
+		return PermError, domain, errors.New("spf: too many redirects/includes")
+	}
+
+	txts, rr, err := s.resolver.LookupTXT(s.ctx, domain)
+	if rr == lookup.ResolveTempFail {
+		return TempError, domain, err
+	}
+
+	var record string
+	found := 0
+	for _, txt := range txts {
+		if isSPFRecord(txt) {
+			found++
+			record = txt
+		}
+	}
+	if found == 0 {
+		return None, domain, nil
+	}
+	if found > 1 {
+		return PermError, domain, fmt.Errorf("spf: multiple SPF records published for %s", domain)
+	}
+
+	var redirect string
+
+	for _, raw := range strings.Fields(record)[1:] {
+		pt := parseTerm(raw)
+		if pt.modifier {
+			switch pt.name {
+			case "redirect":
+				redirect = pt.rest
+			case "exp":
+				return Neutral, domain, nil
+			}
+			continue
+		}
+
+		switch pt.name {
+		case "all":
+			return qualifierResult(pt.qualifier), domain, nil
+
+		case "include":
+			value := strings.TrimPrefix(pt.rest, ":")
+			if containsMacro(value) {
+				return Neutral, domain, nil
+			}
+			if err := s.countLookup(); err != nil {
+				return PermError, domain, err
+			}
+			res, _, err := s.checkHost(value, ip, depth+1)
+			switch res {
+			case Pass:
+				return qualifierResult(pt.qualifier), domain, nil
+			case TempError:
+				return TempError, domain, err
+			case PermError:
+				return PermError, domain, err
+			case None:
+				return PermError, domain, fmt.Errorf("spf: include target %s has no SPF record", value)
+			}
+			// Fail/SoftFail/Neutral: the included domain didn't match
+			// this message; keep evaluating later terms.
+
+		case "a", "mx":
+			spec := parseASpec(pt.rest, domain)
+			if containsMacro(spec.domain) {
+				return Neutral, domain, nil
+			}
+			if err := s.countLookup(); err != nil {
+				return PermError, domain, err
+			}
+			match, err := s.matchAorMX(pt.name, spec, ip)
+			if err != nil {
+				if errors.Is(err, ErrTooManyDNSLookups) || errors.Is(err, ErrTooManyVoidLookups) {
+					return PermError, domain, err
+				}
+				return TempError, domain, err
+			}
+			if match {
+				return qualifierResult(pt.qualifier), domain, nil
+			}
+
+		case "ip4":
+			match, err := matchIPValue(ip, strings.TrimPrefix(pt.rest, ":"))
+			if err != nil {
+				return PermError, domain, err
+			}
+			if match {
+				return qualifierResult(pt.qualifier), domain, nil
+			}
+
+		case "ip6":
+			match, err := matchIPValue(ip, strings.TrimPrefix(pt.rest, ":"))
+			if err != nil {
+				return PermError, domain, err
+			}
+			if match {
+				return qualifierResult(pt.qualifier), domain, nil
+			}
+
+		case "ptr", "exists":
+			// Both require a reverse-DNS walk or macro expansion we
+			// don't implement; fail open instead of guessing.
+			return Neutral, domain, nil
+
+		default:
+			return PermError, domain, fmt.Errorf("spf: unknown mechanism %q", pt.name)
+		}
+	}
+
+	if redirect != "" {
+		if containsMacro(redirect) {
+			return Neutral, domain, nil
+		}
+		if err := s.countLookup(); err != nil {
+			return PermError, domain, err
+		}
+		res, authDomain, err := s.checkHost(redirect, ip, depth+1)
+		if res == None {
+			return PermError, domain, fmt.Errorf("spf: redirect target %s has no SPF record", redirect)
+		}
+		return res, authDomain, err
+	}
+
+	// RFC 7208 section 4.7: falling off the end of the record with no
+	// match and no redirect is Neutral.
+	return Neutral, domain, nil
+}
+
+// matchAorMX evaluates an "a" or "mx" mechanism. For "mx" it resolves
+// the target's MX hosts first; each host's own address lookup is not
+// separately counted against the DNS-lookup limit, since the "mx"
+// mechanism itself already was.
+func (s *state) matchAorMX(kind string, spec aSpec, ip net.IP) (bool, error) {
+	hosts := []string{spec.domain}
+	if kind == "mx" {
+		mxHosts, rr, err := s.resolver.LookupMX(s.ctx, spec.domain)
+		if rr == lookup.ResolveTempFail {
+			return false, err
+		}
+		if err := s.countVoidIfEmpty(rr, len(mxHosts)); err != nil {
+			return false, err
+		}
+		hosts = mxHosts
+	}
+
+	for _, host := range hosts {
+		match, err := s.matchHostAddrs(host, spec, ip)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *state) matchHostAddrs(host string, spec aSpec, ip net.IP) (bool, error) {
+	if ip.To4() != nil {
+		addrs, rr, err := s.resolver.LookupA(s.ctx, host)
+		if rr == lookup.ResolveTempFail {
+			return false, err
+		}
+		if err := s.countVoidIfEmpty(rr, len(addrs)); err != nil {
+			return false, err
+		}
+		return addrsContain(addrs, ip, spec.cidr4), nil
+	}
+
+	addrs, rr, err := s.resolver.LookupAAAA(s.ctx, host)
+	if rr == lookup.ResolveTempFail {
+		return false, err
+	}
+	if err := s.countVoidIfEmpty(rr, len(addrs)); err != nil {
+		return false, err
+	}
+	return addrsContain(addrs, ip, spec.cidr6), nil
+}
+
+func addrsContain(addrs []net.IP, ip net.IP, bits int) bool {
+	for _, a := range addrs {
+		if cidrContains(a, ip, bits) {
+			return true
+		}
+	}
+	return false
+}
+
+func cidrContains(candidate, target net.IP, bits int) bool {
+	if c4, t4 := candidate.To4(), target.To4(); c4 != nil && t4 != nil {
+		mask := net.CIDRMask(bits, 32)
+		return c4.Mask(mask).Equal(t4.Mask(mask))
+	}
+	c16, t16 := candidate.To16(), target.To16()
+	if c16 == nil || t16 == nil {
+		return false
+	}
+	mask := net.CIDRMask(bits, 128)
+	return c16.Mask(mask).Equal(t16.Mask(mask))
+}
+
+func matchIPValue(ip net.IP, value string) (bool, error) {
+	if strings.Contains(value, "/") {
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return false, fmt.Errorf("spf: invalid ip mechanism value %q: %w", value, err)
+		}
+		return ipnet.Contains(ip), nil
+	}
+	want := net.ParseIP(value)
+	if want == nil {
+		return false, fmt.Errorf("spf: invalid ip mechanism value %q", value)
+	}
+	return ip.Equal(want), nil
+}
+
+// aSpec is the parsed domain-spec and optional dual-cidr-length of an
+// "a" or "mx" mechanism.
+type aSpec struct {
+	domain string
+	cidr4  int
+	cidr6  int
+}
+
+// parseASpec parses the part of an "a"/"mx" mechanism after its name,
+// e.g. ":example.com/24", "/24/64" or "". currentDomain is used when no
+// domain-spec is given.
+func parseASpec(rest, currentDomain string) aSpec {
+	spec := aSpec{domain: currentDomain, cidr4: 32, cidr6: 128}
+	if rest == "" {
+		return spec
+	}
+
+	var cidrPart string
+	if strings.HasPrefix(rest, ":") {
+		rest = rest[1:]
+		if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+			spec.domain, cidrPart = rest[:idx], rest[idx+1:]
+		} else {
+			spec.domain = rest
+		}
+	} else if strings.HasPrefix(rest, "/") {
+		cidrPart = rest[1:]
+	}
+
+	if cidrPart == "" {
+		return spec
+	}
+	parts := strings.SplitN(cidrPart, "/", 2)
+	if n, err := strconv.Atoi(parts[0]); err == nil {
+		spec.cidr4 = n
+	}
+	if len(parts) == 2 {
+		if n, err := strconv.Atoi(parts[1]); err == nil {
+			spec.cidr6 = n
+		}
+	}
+	return spec
+}
+
+// parsedTerm is one space-separated term of an SPF record: either a
+// mechanism (with an optional qualifier) or a modifier.
+type parsedTerm struct {
+	qualifier byte
+	name      string
+	rest      string
+	modifier  bool
+}
+
+func parseTerm(raw string) parsedTerm {
+	qualifier := byte('+')
+	t := raw
+	if len(t) > 0 {
+		switch t[0] {
+		case '+', '-', '~', '?':
+			qualifier = t[0]
+			t = t[1:]
+		}
+	}
+
+	if eq := strings.IndexByte(t, '='); eq >= 0 {
+		return parsedTerm{name: strings.ToLower(t[:eq]), rest: t[eq+1:], modifier: true}
+	}
+
+	name := t
+	rest := ""
+	if idx := strings.IndexAny(t, ":/"); idx >= 0 {
+		name, rest = t[:idx], t[idx:]
+	}
+	return parsedTerm{qualifier: qualifier, name: strings.ToLower(name), rest: rest}
+}
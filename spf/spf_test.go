@@ -0,0 +1,123 @@
+package spf
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/ncsham/go-openDMARC/dmarctest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMechanisms(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT: map[string][]string{
+			"example.com":    {"v=spf1 ip4:203.0.113.0/24 a:a.example.com mx:mx.example.com include:_spf.other.com ~all"},
+			"_spf.other.com": {"v=spf1 ip4:198.51.100.1 -all"},
+			"redirect.com":   {"v=spf1 redirect=example.com"},
+			"noall.com":      {"v=spf1 ip4:203.0.113.0/24"},
+			"macro.com":      {"v=spf1 a:%{i}.example.com -all"},
+		},
+		A: map[string][]net.IP{
+			"a.example.com": {net.ParseIP("192.0.2.1")},
+		},
+		MX: map[string][]string{
+			"mx.example.com": {"mx-a.example.com"},
+		},
+	}
+	resolver.A["mx-a.example.com"] = []net.IP{net.ParseIP("192.0.2.2")}
+
+	testCases := []struct {
+		name       string
+		domain     string
+		ip         string
+		mailFrom   string
+		want       Result
+		wantDomain Domain
+	}{
+		{"ip4 match", "", "203.0.113.5", "user@example.com", Pass, "example.com"},
+		{"a match", "", "192.0.2.1", "user@example.com", Pass, "example.com"},
+		{"mx match", "", "192.0.2.2", "user@example.com", Pass, "example.com"},
+		{"include match", "", "198.51.100.1", "user@example.com", Pass, "example.com"},
+		{"no match falls to all", "", "192.0.2.99", "user@example.com", SoftFail, "example.com"},
+		{"redirect follows to target domain", "", "203.0.113.5", "user@redirect.com", Pass, "example.com"},
+		{"no all and no match is neutral", "", "192.0.2.99", "user@noall.com", Neutral, "noall.com"},
+		{"unsupported macro fails open", "", "192.0.2.99", "user@macro.com", Neutral, "macro.com"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, domain, err := Check(context.Background(), net.ParseIP(tc.ip), tc.mailFrom, "helo.example.com", resolver)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, tc.wantDomain, domain)
+		})
+	}
+}
+
+func TestCheckNoRecord(t *testing.T) {
+	resolver := dmarctest.MockResolver{TXT: map[string][]string{}}
+	got, domain, err := Check(context.Background(), net.ParseIP("203.0.113.5"), "user@nospf.com", "helo.example.com", resolver)
+	require.NoError(t, err)
+	require.Equal(t, None, got)
+	require.Equal(t, Domain("nospf.com"), domain)
+}
+
+func TestCheckTempFail(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT:      map[string][]string{},
+		TempFail: map[string]bool{"flaky.com": true},
+	}
+	got, _, err := Check(context.Background(), net.ParseIP("203.0.113.5"), "user@flaky.com", "helo.example.com", resolver)
+	require.Error(t, err)
+	require.Equal(t, TempError, got)
+}
+
+func TestCheckNoMailFromFallsBackToHelo(t *testing.T) {
+	resolver := dmarctest.MockResolver{
+		TXT: map[string][]string{
+			"helo.example.com": {"v=spf1 ip4:203.0.113.0/24 -all"},
+		},
+	}
+	got, domain, err := Check(context.Background(), net.ParseIP("203.0.113.5"), "", "helo.example.com", resolver)
+	require.NoError(t, err)
+	require.Equal(t, Pass, got)
+	require.Equal(t, Domain("helo.example.com"), domain)
+}
+
+func TestParseTerm(t *testing.T) {
+	testCases := []struct {
+		raw  string
+		want parsedTerm
+	}{
+		{"all", parsedTerm{qualifier: '+', name: "all"}},
+		{"-all", parsedTerm{qualifier: '-', name: "all"}},
+		{"~include:example.com", parsedTerm{qualifier: '~', name: "include", rest: ":example.com"}},
+		{"ip4:203.0.113.0/24", parsedTerm{qualifier: '+', name: "ip4", rest: ":203.0.113.0/24"}},
+		{"redirect=example.com", parsedTerm{name: "redirect", rest: "example.com", modifier: true}},
+		{"a/24", parsedTerm{qualifier: '+', name: "a", rest: "/24"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.raw, func(t *testing.T) {
+			require.Equal(t, tc.want, parseTerm(tc.raw))
+		})
+	}
+}
+
+func TestParseASpec(t *testing.T) {
+	testCases := []struct {
+		name   string
+		rest   string
+		domain string
+		want   aSpec
+	}{
+		{"bare", "", "example.com", aSpec{domain: "example.com", cidr4: 32, cidr6: 128}},
+		{"domain only", ":other.com", "example.com", aSpec{domain: "other.com", cidr4: 32, cidr6: 128}},
+		{"cidr4 only", "/24", "example.com", aSpec{domain: "example.com", cidr4: 24, cidr6: 128}},
+		{"domain and dual cidr", ":other.com/24/64", "example.com", aSpec{domain: "other.com", cidr4: 24, cidr6: 64}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, parseASpec(tc.rest, tc.domain))
+		})
+	}
+}